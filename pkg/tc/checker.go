@@ -18,51 +18,103 @@ package tc
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/binary"
 	"github.com/codenotary/immudb/pkg/api/schema"
 	"github.com/codenotary/immudb/pkg/client"
 	"github.com/codenotary/immudb/pkg/logger"
-	mrand "math/rand"
+	"golang.org/x/time/rate"
+	"sync/atomic"
 	"time"
 )
 
 // ErrConsistencyFail happens when a consistency check fails. Check the log to retrieve details on which element is failing
 const ErrConsistencyFail = "consistency check fail at index %d"
 
+// trustedFlag is a concurrency-safe bool: it is written concurrently from the scanning
+// goroutines spawned by scanRange and read by checkLevel0 when it builds each cycle's Status,
+// so a plain bool field would be a data race.
+type trustedFlag struct {
+	v int32
+}
+
+func (t *trustedFlag) set(trusted bool) {
+	var i int32
+	if trusted {
+		i = 1
+	}
+	atomic.StoreInt32(&t.v, i)
+}
+
+func (t *trustedFlag) get() bool {
+	return atomic.LoadInt32(&t.v) == 1
+}
+
 type immuTc struct {
-	Client  client.ImmuClient
-	Logger  logger.Logger
-	Quit    bool
-	Trusted bool
+	Client   client.ImmuClient
+	Logger   logger.Logger
+	Store    AuditStore
+	Quit     bool
+	PrevRoot *schema.Root
+	trusted  trustedFlag
+
+	workers       int
+	chunkSize     uint64
+	limiter       *rate.Limiter
+	pendingChunks []*chunk
+	peers         []string
+
+	metrics       *metrics
+	metricsAddr   string
+	metricsServer metricsServerBox
+	status        statusBox
 }
 
 // ImmuTc trust checker interface
 type ImmuTc interface {
 	Start(context.Context) (err error)
 	Stop(context.Context)
-	GetStatus(context.Context) bool
+	// GetStatus returns a snapshot of the trust checker's last completed scanning cycle.
+	GetStatus(context.Context) Status
+	// GetHistory returns every root the trust checker observed and persisted between
+	// from and to (inclusive), so an operator can prove after the fact what was seen and when.
+	GetHistory(ctx context.Context, from, to uint64) ([]*RootEntry, error)
 }
 
-// NewImmuTc returns new trust checker service
-func NewImmuTc(c client.ImmuClient, l logger.Logger) ImmuTc {
-	return &immuTc{c, l, false, true}
+// NewImmuTc returns new trust checker service. store is used to persist the consistent index,
+// the observed roots and any verification failures across restarts. opts configures the worker
+// pool used to scan chunks and other optional behaviour, see WithWorkers, WithChunkSize,
+// WithRateLimit, WithPeers and WithMetricsAddr.
+func NewImmuTc(c client.ImmuClient, l logger.Logger, store AuditStore, opts ...Option) ImmuTc {
+	s := &immuTc{Client: c, Logger: l, Store: store, Quit: false, metrics: newMetrics()}
+	s.trusted.set(true)
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Start start the trust checker loop
 func (s *immuTc) Start(ctx context.Context) (err error) {
 	s.Logger.Infof("Start scanning ...")
+	if s.metricsAddr != "" {
+		go s.serveMetrics(ctx)
+	}
 	return s.checkLevel0(ctx)
 }
 
 // Stop stop the trust checker loop
 func (s *immuTc) Stop(ctx context.Context) {
 	s.Quit = true
+	_ = s.metricsServer.close()
+}
+
+// GetStatus returns a snapshot of the trust checker's last completed scanning cycle.
+func (s *immuTc) GetStatus(ctx context.Context) Status {
+	return s.status.get()
 }
 
-// GetStatus return status of the trust checker. False means that a consistency checks was failed
-func (s *immuTc) GetStatus(ctx context.Context) bool {
-	return s.Trusted
+// GetHistory returns every root persisted by the audit store between from and to (inclusive).
+func (s *immuTc) GetHistory(ctx context.Context, from, to uint64) ([]*RootEntry, error) {
+	return s.Store.GetHistory(from, to)
 }
 
 func (s *immuTc) checkLevel0(ctx context.Context) (err error) {
@@ -79,24 +131,69 @@ func (s *immuTc) checkLevel0(ctx context.Context) (err error) {
 			s.sleep()
 			continue
 		}
-		// create a range with all index presents in immudb
-		ids := makeRange(0, r.Index)
-		rn := mrand.New(newCryptoRandSource())
-		// shuffle indexes
-		rn.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
-		s.Logger.Infof("Start scanning %d elements", len(ids))
-		for _, id := range ids {
-			var item *client.VerifiedItem
-			if item, err = s.Client.ByRawSafeIndex(ctx, id); err != nil {
-				s.Logger.Errorf("Error retrieving element at index %d: %s", id, err)
-				continue
+		fetchedAt := time.Now()
+
+		if s.PrevRoot != nil && s.PrevRoot.Index != r.Index {
+			if err := s.checkLevel1(ctx, s.PrevRoot, r); err != nil {
+				s.Logger.Errorf("Error checking consistency between index %d and %d: %s", s.PrevRoot.Index, r.Index, err)
 			}
-			s.Logger.Debugf("Item index %d, value %s, verified %t", item.Index, item.Value, item.Verified)
-			if !item.Verified {
-				s.Trusted = false
-				s.Logger.Errorf(ErrConsistencyFail, item.Index)
+		}
+
+		cindex, resumed, err := s.Store.GetConsistentIndex()
+		if err != nil {
+			s.Logger.Errorf("Error reading consistent index: %s", err)
+			s.sleep()
+			continue
+		}
+		from := uint64(0)
+		if resumed {
+			from = cindex + 1
+		}
+		if from > r.Index {
+			s.Logger.Infof("Already consistent up to index %d, nothing new to scan", cindex)
+			s.sleep()
+			continue
+		}
+
+		// only scan the range that was appended since the last tick
+		s.Logger.Infof("Start scanning %d elements", r.Index-from+1)
+		stats := s.scanRange(ctx, from, r.Index)
+		s.Logger.Infof("Scanned %d elements in %s (%.2f items/sec), %d verified, %d failed",
+			stats.ItemsVerified+stats.ItemsFailed, stats.Duration, stats.ItemsPerSecond(), stats.ItemsVerified, stats.ItemsFailed)
+
+		entry := &RootEntry{Index: r.Index, Root: r.Root, Timestamp: time.Now()}
+		if err := s.Store.AddRoot(entry); err != nil {
+			s.Logger.Errorf("Error persisting root at index %d: %s", r.Index, err)
+		}
+		if len(s.peers) > 0 {
+			s.gossip(ctx, entry)
+		}
+		if stats.HighestConsistentIndex != nil {
+			if err := s.Store.SetConsistentIndex(*stats.HighestConsistentIndex); err != nil {
+				s.Logger.Errorf("Error persisting consistent index %d: %s", *stats.HighestConsistentIndex, err)
 			}
+		} else {
+			s.Logger.Infof("No contiguous progress this cycle, consistent index stays at %d", cindex)
 		}
+
+		status := Status{
+			Trusted:           s.trusted.get(),
+			LastCheckedIndex:  r.Index,
+			ItemsVerified:     stats.ItemsVerified,
+			ItemsFailed:       stats.ItemsFailed,
+			CycleDuration:     stats.Duration,
+			LastRootFetch:     fetchedAt,
+			FirstFailingIndex: stats.FirstFailingIndex,
+			CurrentRoot:       r.Root,
+		}
+		if s.PrevRoot != nil {
+			status.PreviousRoot = s.PrevRoot.Root
+		}
+		s.status.set(status)
+		s.metrics.observeCycle(status)
+
+		s.PrevRoot = r
+
 		s.sleep()
 	}
 	return s.checkLevel0(ctx)
@@ -106,26 +203,3 @@ func (s *immuTc) sleep() {
 	s.Logger.Infof("Sleeping for some seconds ...")
 	time.Sleep(10 * time.Second)
 }
-
-func makeRange(min, max uint64) []uint64 {
-	a := make([]uint64, max-min+1)
-	var i uint64
-	for i = min; i <= max; i++ {
-		a[i] = i
-	}
-	return a
-}
-
-type cryptoRandSource struct{}
-
-func newCryptoRandSource() cryptoRandSource {
-	return cryptoRandSource{}
-}
-
-func (_ cryptoRandSource) Int63() int64 {
-	var b [8]byte
-	_, _ = rand.Read(b[:])
-	return int64(binary.LittleEndian.Uint64(b[:]) & (1<<63 - 1))
-}
-
-func (_ cryptoRandSource) Seed(_ int64) {}
@@ -0,0 +1,151 @@
+/*
+Copyright 2019-2020 vChain, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+)
+
+// ErrSplitView happens when a consistency proof shows that a previously observed root is no
+// longer reachable from the current one, i.e. the server's history is not append-only anymore.
+const ErrSplitView = "consistency proof fail: root at index %d is no longer consistent with root at index %d"
+
+// errShortProof is returned by verifyConsistency when the supplied proof does not contain enough
+// sibling hashes to reconstruct both roots.
+var errShortProof = errors.New("consistency proof too short")
+
+// hashNode combines two child hashes into their parent hash, following the RFC 6962 tree hashing
+// convention: hash(0x01 || left || right).
+func hashNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// verifyConsistency checks that root2, the root of a tree of size2 elements, is a valid
+// append-only extension of root1, the root of a tree of size1 elements, given the sibling hash
+// path proof returned by the server. It implements the standard RFC 6962 consistency proof
+// verification algorithm: proof is walked according to the bit decomposition of size1 and size2,
+// reconstructing root1 first and then extending the same path to reconstruct root2.
+func verifyConsistency(proof [][]byte, size1, size2 uint64, root1, root2 []byte) (bool, error) {
+	if size1 == size2 {
+		if len(proof) != 0 {
+			return false, nil
+		}
+		return bytes.Equal(root1, root2), nil
+	}
+	if size1 == 0 {
+		// an empty tree is consistent with anything, there is nothing to prove
+		return len(proof) == 0, nil
+	}
+	if size1 > size2 {
+		return false, errors.New("size1 > size2")
+	}
+	if len(proof) == 0 {
+		return false, errShortProof
+	}
+
+	node := size1 - 1
+	lastNode := size2 - 1
+	proofIdx := 0
+
+	for node%2 == 1 {
+		node /= 2
+		lastNode /= 2
+	}
+
+	var fn, sn []byte
+	if node > 0 {
+		fn = proof[proofIdx]
+		sn = proof[proofIdx]
+		proofIdx++
+	} else {
+		fn = root1
+		sn = root1
+	}
+
+	for node > 0 {
+		if node%2 == 1 {
+			if proofIdx >= len(proof) {
+				return false, errShortProof
+			}
+			fn = hashNode(proof[proofIdx], fn)
+			sn = hashNode(proof[proofIdx], sn)
+			proofIdx++
+		} else if node < lastNode {
+			if proofIdx >= len(proof) {
+				return false, errShortProof
+			}
+			sn = hashNode(sn, proof[proofIdx])
+			proofIdx++
+		}
+		node /= 2
+		lastNode /= 2
+	}
+
+	if !bytes.Equal(fn, root1) {
+		return false, nil
+	}
+
+	for lastNode > 0 {
+		if proofIdx >= len(proof) {
+			return false, errShortProof
+		}
+		sn = hashNode(sn, proof[proofIdx])
+		proofIdx++
+		lastNode /= 2
+	}
+
+	return bytes.Equal(sn, root2), nil
+}
+
+// checkLevel1 proves that newRoot is an append-only extension of prevRoot by fetching a
+// consistency proof from the server and recomputing prevRoot from newRoot's tree. Unlike
+// checkLevel0, which only proves inclusion of random elements, this proves that the whole
+// history between the two roots was not rewritten.
+func (s *immuTc) checkLevel1(ctx context.Context, prevRoot, newRoot *schema.Root) error {
+	proof, err := s.Client.ConsistencyProof(ctx, prevRoot.Index, newRoot.Index)
+	if err != nil {
+		return err
+	}
+
+	// an error from verifyConsistency (e.g. a rollback where the server now reports a smaller
+	// index than it previously did, or a proof too short to reconstruct both roots) is just as
+	// much evidence of tampering as a clean ok == false: either way newRoot cannot be proven to
+	// be an append-only extension of prevRoot.
+	ok, verifyErr := verifyConsistency(proof.Hashes, prevRoot.Index+1, newRoot.Index+1, prevRoot.Root, newRoot.Root)
+	if !ok || verifyErr != nil {
+		s.trusted.set(false)
+		s.Logger.Errorf(ErrSplitView, prevRoot.Index, newRoot.Index)
+		s.Logger.Errorf("previous root: %x", prevRoot.Root)
+		s.Logger.Errorf("current root: %x", newRoot.Root)
+		if verifyErr != nil {
+			s.Logger.Errorf("consistency proof verification error: %s", verifyErr)
+		}
+		if err := s.Store.AddFailure(newRoot.Index); err != nil {
+			s.Logger.Errorf("Error persisting failure at index %d: %s", newRoot.Index, err)
+		}
+	}
+	return nil
+}
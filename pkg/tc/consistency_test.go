@@ -0,0 +1,138 @@
+/*
+Copyright 2019-2020 vChain, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tc
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+// The helpers below build a reference Merkle tree hash (MTH) and consistency proofs for it,
+// following RFC 6962 section 2.1, purely to produce known-good test vectors for
+// verifyConsistency. They are not used outside of tests.
+
+func leafHashT(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func largestPowerOfTwoLessThan(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+func mth(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return leafHashT(leaves[0])
+	}
+	k := largestPowerOfTwoLessThan(len(leaves))
+	return hashNode(mth(leaves[:k]), mth(leaves[k:]))
+}
+
+func subproof(m int, leaves [][]byte, b bool) [][]byte {
+	n := len(leaves)
+	if m == n {
+		if b {
+			return nil
+		}
+		return [][]byte{mth(leaves)}
+	}
+	k := largestPowerOfTwoLessThan(n)
+	if m <= k {
+		proof := subproof(m, leaves[:k], b)
+		return append(proof, mth(leaves[k:]))
+	}
+	proof := subproof(m-k, leaves[k:], false)
+	return append(proof, mth(leaves[:k]))
+}
+
+func testLeaves(n int) [][]byte {
+	leaves := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		leaves[i] = []byte{byte(i)}
+	}
+	return leaves
+}
+
+func TestVerifyConsistencyKnownVectors(t *testing.T) {
+	cases := []struct {
+		name string
+		m, n int
+	}{
+		{"1->2", 1, 2},
+		{"3->7 (m+1 is a power of two)", 3, 7},
+		{"5->8", 5, 8},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			leaves := testLeaves(c.n)
+			proof := subproof(c.m, leaves, true)
+			root1 := mth(leaves[:c.m])
+			root2 := mth(leaves)
+
+			ok, err := verifyConsistency(proof, uint64(c.m), uint64(c.n), root1, root2)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !ok {
+				t.Fatalf("expected proof from size %d to %d to verify", c.m, c.n)
+			}
+		})
+	}
+}
+
+func TestVerifyConsistencyDetectsFork(t *testing.T) {
+	leaves := testLeaves(7)
+	proof := subproof(3, leaves, true)
+	root1 := mth(leaves[:3])
+	root2 := mth(leaves)
+
+	// flip a byte in one proof element to simulate a server that served a different history
+	corrupted := make([][]byte, len(proof))
+	copy(corrupted, proof)
+	tampered := make([]byte, len(corrupted[0]))
+	copy(tampered, corrupted[0])
+	tampered[0] ^= 0xFF
+	corrupted[0] = tampered
+
+	ok, err := verifyConsistency(corrupted, 3, 7, root1, root2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok {
+		t.Fatalf("expected tampered proof to fail verification")
+	}
+}
+
+func TestVerifyConsistencySameSize(t *testing.T) {
+	leaves := testLeaves(4)
+	root := mth(leaves)
+
+	ok, err := verifyConsistency(nil, 4, 4, root, root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ok {
+		t.Fatalf("expected equal roots with empty proof to verify")
+	}
+}
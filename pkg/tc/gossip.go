@@ -0,0 +1,194 @@
+/*
+Copyright 2019-2020 vChain, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/codenotary/immudb/pkg/logger"
+)
+
+// ErrSplitViewGossip happens when a peer auditor reports a different root than the one observed
+// locally at the same index, i.e. the server is serving at least two different histories.
+const ErrSplitViewGossip = "split view detected: peer %s reports a different root at index %d"
+
+// gossipResponse is returned by a PeerServer's /submit handler. Match is informational only:
+// since the peer is unauthenticated, callers must not treat it as ground truth and should instead
+// compare PeerRoot against their own observation themselves, see gossip.
+type gossipResponse struct {
+	Match    bool       `json:"match"`
+	PeerRoot *RootEntry `json:"peer_root,omitempty"`
+}
+
+// WithPeers configures the immudb replica or auditor endpoints this instance gossips its
+// observed roots with, so a server serving a different history to each observer can be caught.
+func WithPeers(peers []string) Option {
+	return func(s *immuTc) { s.peers = peers }
+}
+
+// gossip submits entry to every configured peer and compares the root each peer reports back at
+// the same index. The comparison is done locally against resp.PeerRoot rather than trusting the
+// peer's own Match verdict: /submit and /roots are unauthenticated, so a compromised or spoofed
+// peer endpoint could otherwise defeat split-view detection outright just by always answering
+// match=true. A mismatch is recorded as a SplitView, keyed by peer and index so that disagreeing
+// peers in the same round don't overwrite each other's evidence.
+func (s *immuTc) gossip(ctx context.Context, entry *RootEntry) {
+	for _, peer := range s.peers {
+		resp, err := s.submitToPeer(ctx, peer, entry)
+		if err != nil {
+			s.Logger.Errorf("Error gossiping root at index %d to peer %s: %s", entry.Index, peer, err)
+			continue
+		}
+		if resp.PeerRoot == nil {
+			// the peer has no observation at this index yet, nothing to compare
+			continue
+		}
+		if !bytes.Equal(resp.PeerRoot.Root, entry.Root) {
+			s.trusted.set(false)
+			s.Logger.Errorf(ErrSplitViewGossip, peer, entry.Index)
+			sv := &SplitView{Peer: peer, Local: entry, Remote: resp.PeerRoot, Timestamp: time.Now()}
+			if err := s.Store.AddSplitView(sv); err != nil {
+				s.Logger.Errorf("Error persisting split view at index %d for peer %s: %s", entry.Index, peer, err)
+			}
+		}
+	}
+}
+
+func (s *immuTc) submitToPeer(ctx context.Context, peer string, entry *RootEntry) (*gossipResponse, error) {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer+"/submit", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer %s returned status %d", peer, res.StatusCode)
+	}
+
+	var gr gossipResponse
+	if err := json.NewDecoder(res.Body).Decode(&gr); err != nil {
+		return nil, err
+	}
+	return &gr, nil
+}
+
+// PeerServer exposes a trust checker's observed history to other auditors, so they can gossip
+// roots with it and detect a server presenting a split view of its history.
+type PeerServer struct {
+	Tc     ImmuTc
+	Store  AuditStore
+	Logger logger.Logger
+}
+
+// NewPeerServer returns a PeerServer backed by tc's history and store.
+func NewPeerServer(tc ImmuTc, store AuditStore, l logger.Logger) *PeerServer {
+	return &PeerServer{Tc: tc, Store: store, Logger: l}
+}
+
+// Handler returns the http.Handler serving /roots and /submit.
+func (p *PeerServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/roots", p.handleRoots)
+	mux.HandleFunc("/submit", p.handleSubmit)
+	return mux
+}
+
+// handleRoots returns every root this auditor observed between the from and to query
+// parameters (inclusive), so a peer can pull and compare our history directly.
+func (p *PeerServer) handleRoots(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	history, err := p.Tc.GetHistory(r.Context(), from, to)
+	if err != nil {
+		p.Logger.Errorf("Error reading history: %s", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, history)
+}
+
+// handleSubmit receives a root observed by a peer and compares it against the root this
+// auditor observed at the same index, reporting back whether they match.
+func (p *PeerServer) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var entry RootEntry
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	history, err := p.Store.GetHistory(entry.Index, entry.Index)
+	if err != nil {
+		p.Logger.Errorf("Error reading history at index %d: %s", entry.Index, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := gossipResponse{Match: true}
+	if len(history) > 0 {
+		resp.PeerRoot = history[0]
+		resp.Match = bytes.Equal(history[0].Root, entry.Root)
+	}
+	writeJSON(w, resp)
+}
+
+func parseRange(r *http.Request) (from, to uint64, err error) {
+	from, err = parseUint(r.URL.Query().Get("from"), 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err = parseUint(r.URL.Query().Get("to"), ^uint64(0))
+	if err != nil {
+		return 0, 0, err
+	}
+	return from, to, nil
+}
+
+func parseUint(s string, def uint64) (uint64, error) {
+	if s == "" {
+		return def, nil
+	}
+	var v uint64
+	_, err := fmt.Sscanf(s, "%d", &v)
+	return v, err
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
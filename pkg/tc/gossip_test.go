@@ -0,0 +1,177 @@
+/*
+Copyright 2019-2020 vChain, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tc
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// testLogger is a minimal logger.Logger stand-in: gossip() logs unconditionally on a mismatch,
+// so tests exercising that path need something to call without pulling in the real logger package.
+type testLogger struct{}
+
+func (testLogger) Errorf(string, ...interface{})   {}
+func (testLogger) Warningf(string, ...interface{}) {}
+func (testLogger) Infof(string, ...interface{})    {}
+func (testLogger) Debugf(string, ...interface{})   {}
+
+// fakeStore is a minimal in-memory AuditStore, used in place of boltAuditStore so gossip tests
+// don't need a temp file and can inspect recorded split views directly.
+type fakeStore struct {
+	mu         sync.Mutex
+	history    map[uint64]*RootEntry
+	splitViews map[uint64][]*SplitView
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		history:    map[uint64]*RootEntry{},
+		splitViews: map[uint64][]*SplitView{},
+	}
+}
+
+func (f *fakeStore) GetConsistentIndex() (uint64, bool, error) { return 0, false, nil }
+func (f *fakeStore) SetConsistentIndex(uint64) error           { return nil }
+func (f *fakeStore) AddRoot(entry *RootEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.history[entry.Index] = entry
+	return nil
+}
+func (f *fakeStore) AddFailure(uint64) error { return nil }
+
+func (f *fakeStore) AddSplitView(sv *SplitView) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.splitViews[sv.Local.Index] = append(f.splitViews[sv.Local.Index], sv)
+	return nil
+}
+
+func (f *fakeStore) GetSplitViews(index uint64) ([]*SplitView, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.splitViews[index], nil
+}
+
+func (f *fakeStore) GetHistory(from, to uint64) ([]*RootEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var entries []*RootEntry
+	for i := from; i <= to; i++ {
+		if e, ok := f.history[i]; ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (f *fakeStore) Close() error { return nil }
+
+func newPeerServer(t *testing.T, root *RootEntry) string {
+	t.Helper()
+	store := newFakeStore()
+	if root != nil {
+		if err := store.AddRoot(root); err != nil {
+			t.Fatalf("AddRoot: %v", err)
+		}
+	}
+	srv := NewPeerServer(nil, store, testLogger{})
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+func TestGossipNoSplitViewOnMatch(t *testing.T) {
+	entry := &RootEntry{Index: 5, Root: []byte("same-root")}
+	peerURL := newPeerServer(t, entry)
+
+	local := &immuTc{Logger: testLogger{}, Store: newFakeStore(), peers: []string{peerURL}}
+	local.trusted.set(true)
+
+	local.gossip(context.Background(), entry)
+
+	if !local.trusted.get() {
+		t.Fatalf("expected trusted to stay true when every peer agrees")
+	}
+	views, err := local.Store.GetSplitViews(entry.Index)
+	if err != nil {
+		t.Fatalf("GetSplitViews: %v", err)
+	}
+	if len(views) != 0 {
+		t.Fatalf("expected no split views on a matching root, got %d", len(views))
+	}
+}
+
+func TestGossipRecordsSplitViewOnMismatch(t *testing.T) {
+	peerURL := newPeerServer(t, &RootEntry{Index: 5, Root: []byte("peer-root")})
+
+	store := newFakeStore()
+	local := &immuTc{Logger: testLogger{}, Store: store, peers: []string{peerURL}}
+	local.trusted.set(true)
+
+	local.gossip(context.Background(), &RootEntry{Index: 5, Root: []byte("local-root")})
+
+	if local.trusted.get() {
+		t.Fatalf("expected trusted to flip to false on a split view")
+	}
+	views, err := store.GetSplitViews(5)
+	if err != nil {
+		t.Fatalf("GetSplitViews: %v", err)
+	}
+	if len(views) != 1 {
+		t.Fatalf("expected 1 split view, got %d", len(views))
+	}
+	if views[0].Peer != peerURL {
+		t.Fatalf("expected split view to record peer %s, got %s", peerURL, views[0].Peer)
+	}
+}
+
+func TestGossipMultiplePeerMismatchesDontOverwrite(t *testing.T) {
+	peerA := newPeerServer(t, &RootEntry{Index: 5, Root: []byte("peer-a-root")})
+	peerB := newPeerServer(t, &RootEntry{Index: 5, Root: []byte("peer-b-root")})
+
+	store := newFakeStore()
+	local := &immuTc{Logger: testLogger{}, Store: store, peers: []string{peerA, peerB}}
+	local.trusted.set(true)
+
+	local.gossip(context.Background(), &RootEntry{Index: 5, Root: []byte("local-root")})
+
+	views, err := store.GetSplitViews(5)
+	if err != nil {
+		t.Fatalf("GetSplitViews: %v", err)
+	}
+	if len(views) != 2 {
+		t.Fatalf("expected evidence from both disagreeing peers to survive, got %d", len(views))
+	}
+}
+
+func TestGossipIgnoresPeerWithNoObservationYet(t *testing.T) {
+	peerURL := newPeerServer(t, nil)
+
+	store := newFakeStore()
+	local := &immuTc{Logger: testLogger{}, Store: store, peers: []string{peerURL}}
+	local.trusted.set(true)
+
+	local.gossip(context.Background(), &RootEntry{Index: 5, Root: []byte("local-root")})
+
+	if !local.trusted.get() {
+		t.Fatalf("expected trusted to stay true when the peer has nothing to compare yet")
+	}
+}
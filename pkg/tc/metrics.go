@@ -0,0 +1,127 @@
+/*
+Copyright 2019-2020 vChain, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics holds the Prometheus collectors tracking the trust checker's activity. Each immuTc
+// instance owns its own registry rather than registering against the global default one, so
+// running more than one in the same process does not panic on duplicate registration.
+type metrics struct {
+	registry             *prometheus.Registry
+	itemsVerifiedTotal   prometheus.Counter
+	verificationFailures prometheus.Counter
+	currentRootIndex     prometheus.Gauge
+	lastCheckTimestamp   prometheus.Gauge
+	cycleDurationSeconds prometheus.Histogram
+}
+
+func newMetrics() *metrics {
+	reg := prometheus.NewRegistry()
+	f := promauto.With(reg)
+	return &metrics{
+		registry: reg,
+		itemsVerifiedTotal: f.NewCounter(prometheus.CounterOpts{
+			Name: "immudb_tc_items_verified_total",
+			Help: "Total number of items successfully verified by the trust checker.",
+		}),
+		verificationFailures: f.NewCounter(prometheus.CounterOpts{
+			Name: "immudb_tc_verification_failures_total",
+			Help: "Total number of items that failed verification.",
+		}),
+		currentRootIndex: f.NewGauge(prometheus.GaugeOpts{
+			Name: "immudb_tc_current_root_index",
+			Help: "Index of the last root observed by the trust checker.",
+		}),
+		lastCheckTimestamp: f.NewGauge(prometheus.GaugeOpts{
+			Name: "immudb_tc_last_check_timestamp_seconds",
+			Help: "Unix timestamp of the root fetch that started the last completed scanning cycle.",
+		}),
+		cycleDurationSeconds: f.NewHistogram(prometheus.HistogramOpts{
+			Name: "immudb_tc_cycle_duration_seconds",
+			Help: "Duration of a full scanning cycle, in seconds.",
+		}),
+	}
+}
+
+func (m *metrics) observeCycle(status Status) {
+	m.itemsVerifiedTotal.Add(float64(status.ItemsVerified))
+	m.verificationFailures.Add(float64(status.ItemsFailed))
+	m.currentRootIndex.Set(float64(status.LastCheckedIndex))
+	m.lastCheckTimestamp.Set(float64(status.LastRootFetch.Unix()))
+	m.cycleDurationSeconds.Observe(status.CycleDuration.Seconds())
+}
+
+// WithMetricsAddr starts a small HTTP server listening on addr that exposes Prometheus metrics
+// at /metrics and the trust checker's current Status as JSON at /status. It is opt-in: by
+// default no server is started.
+func WithMetricsAddr(addr string) Option {
+	return func(s *immuTc) { s.metricsAddr = addr }
+}
+
+// metricsServerBox guards the metrics *http.Server behind a mutex, since it is set by the
+// goroutine Start spawns and closed from Stop, which can run concurrently with it.
+type metricsServerBox struct {
+	mu  sync.Mutex
+	srv *http.Server
+}
+
+func (b *metricsServerBox) set(srv *http.Server) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.srv = srv
+}
+
+func (b *metricsServerBox) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.srv == nil {
+		return nil
+	}
+	return b.srv.Close()
+}
+
+func (s *immuTc) serveMetrics(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.status.get())
+	})
+
+	srv := &http.Server{Addr: s.metricsAddr, Handler: mux}
+	s.metricsServer.set(srv)
+
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	s.Logger.Infof("Serving metrics and status on %s", s.metricsAddr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		s.Logger.Errorf("Error serving metrics: %s", err)
+	}
+}
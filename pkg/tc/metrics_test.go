@@ -0,0 +1,99 @@
+/*
+Copyright 2019-2020 vChain, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tc
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsObserveCycleUpdatesCollectors(t *testing.T) {
+	m := newMetrics()
+
+	now := time.Now()
+	m.observeCycle(Status{
+		ItemsVerified:    10,
+		ItemsFailed:      2,
+		LastCheckedIndex: 99,
+		LastRootFetch:    now,
+		CycleDuration:    2 * time.Second,
+	})
+
+	if got := testutil.ToFloat64(m.itemsVerifiedTotal); got != 10 {
+		t.Fatalf("expected itemsVerifiedTotal to be 10, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.verificationFailures); got != 2 {
+		t.Fatalf("expected verificationFailures to be 2, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.currentRootIndex); got != 99 {
+		t.Fatalf("expected currentRootIndex to be 99, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.lastCheckTimestamp); got != float64(now.Unix()) {
+		t.Fatalf("expected lastCheckTimestamp to be %v, got %v", now.Unix(), got)
+	}
+
+	// observeCycle accumulates across cycles rather than replacing, so a second cycle should add
+	// to the running totals.
+	m.observeCycle(Status{ItemsVerified: 5, ItemsFailed: 1, LastRootFetch: now})
+	if got := testutil.ToFloat64(m.itemsVerifiedTotal); got != 15 {
+		t.Fatalf("expected itemsVerifiedTotal to accumulate to 15, got %v", got)
+	}
+}
+
+func TestMetricsServerBoxCloseBeforeSetIsANoop(t *testing.T) {
+	var box metricsServerBox
+	if err := box.close(); err != nil {
+		t.Fatalf("expected closing an unset box to be a no-op, got %v", err)
+	}
+}
+
+func TestMetricsServerBoxConcurrentSetAndClose(t *testing.T) {
+	// reproduces the Start/Stop race this box exists to fix: Start's goroutine sets the server
+	// around the same time Stop reads and closes it.
+	var box metricsServerBox
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			box.set(&http.Server{Addr: "127.0.0.1:0"})
+		}()
+		go func() {
+			defer wg.Done()
+			_ = box.close()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestNewMetricsUsesItsOwnRegistry(t *testing.T) {
+	a := newMetrics()
+	b := newMetrics()
+
+	if a.registry == b.registry {
+		t.Fatalf("expected each metrics instance to own a distinct registry")
+	}
+
+	// registering two independent instances must not panic on duplicate collector registration
+	a.observeCycle(Status{})
+	b.observeCycle(Status{})
+}
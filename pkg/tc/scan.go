@@ -0,0 +1,264 @@
+/*
+Copyright 2019-2020 vChain, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tc
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const defaultChunkSize = 1024
+
+// Option configures optional parameters of an immuTc instance, applied on top of the defaults
+// by NewImmuTc.
+type Option func(*immuTc)
+
+// WithWorkers sets the number of goroutines used to scan chunks concurrently.
+// Defaults to runtime.NumCPU().
+func WithWorkers(n int) Option {
+	return func(s *immuTc) { s.workers = n }
+}
+
+// WithChunkSize sets the number of indices scanned per chunk. Defaults to 1024.
+func WithChunkSize(n uint64) Option {
+	return func(s *immuTc) { s.chunkSize = n }
+}
+
+// WithRateLimit gates outbound verification RPCs through limiter, so operators can cap the load
+// the trust checker puts on the immudb server.
+func WithRateLimit(limiter *rate.Limiter) Option {
+	return func(s *immuTc) { s.limiter = limiter }
+}
+
+// ScanStats summarizes the throughput of a single scanning cycle.
+type ScanStats struct {
+	ItemsVerified     uint64
+	ItemsFailed       uint64
+	Duration          time.Duration
+	FirstFailingIndex *uint64
+
+	// HighestConsistentIndex is the highest index up to which every index in the scanned range
+	// was either verified or recorded as a definitive failure, i.e. the point up to which it is
+	// safe to advance the persisted consistent index. It is nil when no contiguous progress was
+	// made at all this cycle (the very first chunk did not complete), in which case the caller
+	// should leave the consistent index untouched rather than advance it.
+	HighestConsistentIndex *uint64
+}
+
+// ItemsPerSecond returns the aggregate throughput observed during the cycle.
+func (s ScanStats) ItemsPerSecond() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.ItemsVerified+s.ItemsFailed) / s.Duration.Seconds()
+}
+
+// firstFailureTracker records the lowest index at which verification failed during a cycle,
+// across the concurrently running chunk workers.
+type firstFailureTracker struct {
+	mu    sync.Mutex
+	index uint64
+	has   bool
+}
+
+func (t *firstFailureTracker) record(index uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.has || index < t.index {
+		t.index = index
+		t.has = true
+	}
+}
+
+func (t *firstFailureTracker) get() *uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.has {
+		return nil
+	}
+	index := t.index
+	return &index
+}
+
+// chunk is a contiguous, fixed-size slice of the index range being scanned. next tracks the
+// first not-yet-scanned index in the chunk, so an interrupted chunk can resume instead of being
+// rescanned from start.
+type chunk struct {
+	start, next, end uint64
+}
+
+// buildChunks returns the chunks to scan this cycle: every chunk left over from a previous
+// interrupted scan (pending), followed by fresh chunks of size chunkSize covering whatever of
+// [from, to] is not already represented by one of those pending chunks. from is always the start
+// of the oldest pending chunk (checker.go holds the consistent index at one below it until it
+// completes), so without this a persistently failing chunk would get a brand new duplicate
+// appended on top of itself every cycle, double-scanning the range between them and growing the
+// duplicate work unboundedly instead of simply being retried.
+func buildChunks(from, to, chunkSize uint64, pending []*chunk) []*chunk {
+	chunks := append([]*chunk{}, pending...)
+
+	start := from
+	for _, c := range pending {
+		if c.end+1 > start {
+			start = c.end + 1
+		}
+	}
+
+	for ; start <= to; start += chunkSize {
+		end := start + chunkSize - 1
+		if end > to {
+			end = to
+		}
+		chunks = append(chunks, &chunk{start: start, next: start, end: end})
+	}
+	return chunks
+}
+
+// scanRange scans every index in [from, to], split into chunks of s.chunkSize and consumed by
+// s.workers goroutines, gated by s.limiter when set. Chunks left over from a scan interrupted by
+// context cancellation or a transient error are retried first, resuming from their first
+// unscanned index.
+func (s *immuTc) scanRange(ctx context.Context, from, to uint64) ScanStats {
+	started := time.Now()
+
+	chunks := buildChunks(from, to, s.effectiveChunkSize(), s.pendingChunks)
+	s.pendingChunks = nil
+	if len(chunks) == 0 {
+		return ScanStats{Duration: time.Since(started)}
+	}
+
+	jobs := make(chan *chunk, len(chunks))
+	for _, c := range chunks {
+		jobs <- c
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	var verified, failed uint64
+	var mu sync.Mutex
+	var incomplete []*chunk
+	firstFailure := &firstFailureTracker{}
+
+	for i := 0; i < s.effectiveWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range jobs {
+				if !s.scanChunk(ctx, c, &verified, &failed, firstFailure) {
+					mu.Lock()
+					incomplete = append(incomplete, c)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.pendingChunks = incomplete
+	return ScanStats{
+		ItemsVerified:          verified,
+		ItemsFailed:            failed,
+		Duration:               time.Since(started),
+		FirstFailingIndex:      firstFailure.get(),
+		HighestConsistentIndex: highestConsistentIndex(from, to, incomplete),
+	}
+}
+
+// highestConsistentIndex returns the highest index up to which [from, to] was scanned without
+// leaving any chunk incomplete, or nil if even the first chunk in the range didn't complete.
+// A chunk is left incomplete by a transient error (a failed RPC, or context cancellation) rather
+// than by a definitive verification failure, which is recorded via AuditStore.AddFailure instead
+// and does not block progress.
+func highestConsistentIndex(from, to uint64, incomplete []*chunk) *uint64 {
+	if len(incomplete) == 0 {
+		index := to
+		return &index
+	}
+	minStart := incomplete[0].start
+	for _, c := range incomplete[1:] {
+		if c.start < minStart {
+			minStart = c.start
+		}
+	}
+	if minStart <= from {
+		return nil
+	}
+	index := minStart - 1
+	return &index
+}
+
+// scanChunk verifies every index in c, starting from c.next. It returns false, leaving c.next at
+// the first unscanned index, if it is interrupted by context cancellation or by a transient error
+// retrieving an item, so the chunk is retried from that point on the next cycle instead of being
+// considered scanned. Definitive verification failures (item.Verified == false) are recorded via
+// AuditStore.AddFailure but do not interrupt the chunk, since they are not retryable.
+func (s *immuTc) scanChunk(ctx context.Context, c *chunk, verified, failed *uint64, firstFailure *firstFailureTracker) bool {
+	for id := c.next; id <= c.end; id++ {
+		select {
+		case <-ctx.Done():
+			c.next = id
+			return false
+		default:
+		}
+
+		if s.limiter != nil {
+			if err := s.limiter.Wait(ctx); err != nil {
+				c.next = id
+				return false
+			}
+		}
+
+		item, err := s.Client.ByRawSafeIndex(ctx, id)
+		if err != nil {
+			s.Logger.Errorf("Error retrieving element at index %d: %s", id, err)
+			c.next = id
+			return false
+		}
+		s.Logger.Debugf("Item index %d, value %s, verified %t", item.Index, item.Value, item.Verified)
+		if !item.Verified {
+			s.trusted.set(false)
+			s.Logger.Errorf(ErrConsistencyFail, item.Index)
+			if err := s.Store.AddFailure(item.Index); err != nil {
+				s.Logger.Errorf("Error persisting failure at index %d: %s", item.Index, err)
+			}
+			firstFailure.record(item.Index)
+			atomic.AddUint64(failed, 1)
+		} else {
+			atomic.AddUint64(verified, 1)
+		}
+	}
+	return true
+}
+
+func (s *immuTc) effectiveChunkSize() uint64 {
+	if s.chunkSize == 0 {
+		return defaultChunkSize
+	}
+	return s.chunkSize
+}
+
+func (s *immuTc) effectiveWorkers() int {
+	if s.workers == 0 {
+		return runtime.NumCPU()
+	}
+	return s.workers
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2019-2020 vChain, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tc
+
+import "testing"
+
+func TestHighestConsistentIndexNoIncompleteChunks(t *testing.T) {
+	got := highestConsistentIndex(0, 99, nil)
+	if got == nil || *got != 99 {
+		t.Fatalf("expected 99 with no incomplete chunks, got %v", got)
+	}
+}
+
+func TestHighestConsistentIndexStopsAtFirstIncompleteChunk(t *testing.T) {
+	// a chunk covering [50,99] failed mid-way (e.g. a transient RPC error at index 60): we must
+	// not advance the consistent index past it, even though [0,49] fully verified.
+	incomplete := []*chunk{{start: 50, next: 60, end: 99}}
+	got := highestConsistentIndex(0, 99, incomplete)
+	if got == nil || *got != 49 {
+		t.Fatalf("expected 49 when [50,99] is incomplete, got %v", got)
+	}
+}
+
+func TestHighestConsistentIndexNoProgressWhenFirstChunkFails(t *testing.T) {
+	incomplete := []*chunk{{start: 0, next: 0, end: 99}}
+	got := highestConsistentIndex(0, 99, incomplete)
+	if got != nil {
+		t.Fatalf("expected nil (no progress) when the first chunk never completed, got %v", *got)
+	}
+}
+
+func TestHighestConsistentIndexUsesLowestIncompleteStart(t *testing.T) {
+	incomplete := []*chunk{
+		{start: 200, next: 250, end: 299},
+		{start: 100, next: 120, end: 199},
+	}
+	got := highestConsistentIndex(0, 299, incomplete)
+	if got == nil || *got != 99 {
+		t.Fatalf("expected 99 (one below the lowest incomplete chunk's start), got %v", got)
+	}
+}
+
+func TestBuildChunksWithNoPendingChunksCoversWholeRange(t *testing.T) {
+	chunks := buildChunks(0, 9, 5, nil)
+	assertChunkRanges(t, chunks, [][2]uint64{{0, 4}, {5, 9}})
+}
+
+func TestBuildChunksSkipsRangeAlreadyCoveredByPendingChunks(t *testing.T) {
+	// simulates the second of two scanRange calls: the first cycle's [0,9] chunk never
+	// completed (e.g. a persistently failing index), so checker.go kept from at its start (0)
+	// and carried it forward as pending. Regenerating chunks for [0,19] must not also emit a
+	// brand new [0,9] chunk on top of the pending one.
+	pending := []*chunk{{start: 0, next: 3, end: 9}}
+	chunks := buildChunks(0, 19, 10, pending)
+
+	assertChunkRanges(t, chunks, [][2]uint64{{0, 9}, {10, 19}})
+	if chunks[0].next != 3 {
+		t.Fatalf("expected the pending chunk's progress to be preserved, got next=%d", chunks[0].next)
+	}
+
+	seen := map[uint64]bool{}
+	for _, c := range chunks {
+		for i := c.start; i <= c.end; i++ {
+			if seen[i] {
+				t.Fatalf("index %d is covered by more than one chunk", i)
+			}
+			seen[i] = true
+		}
+	}
+}
+
+func TestBuildChunksWithMultiplePendingChunksSkipsPastTheHighestEnd(t *testing.T) {
+	pending := []*chunk{
+		{start: 0, next: 0, end: 9},
+		{start: 10, next: 15, end: 19},
+	}
+	chunks := buildChunks(0, 29, 10, pending)
+	assertChunkRanges(t, chunks, [][2]uint64{{0, 9}, {10, 19}, {20, 29}})
+}
+
+func TestBuildChunksReturnsOnlyPendingWhenTheyAlreadyCoverTheRange(t *testing.T) {
+	pending := []*chunk{{start: 0, next: 0, end: 9}}
+	chunks := buildChunks(0, 9, 10, pending)
+	assertChunkRanges(t, chunks, [][2]uint64{{0, 9}})
+}
+
+func assertChunkRanges(t *testing.T, chunks []*chunk, want [][2]uint64) {
+	t.Helper()
+	if len(chunks) != len(want) {
+		t.Fatalf("expected %d chunks, got %d: %+v", len(want), len(chunks), chunks)
+	}
+	for i, c := range chunks {
+		if c.start != want[i][0] || c.end != want[i][1] {
+			t.Fatalf("chunk %d: expected [%d,%d], got [%d,%d]", i, want[i][0], want[i][1], c.start, c.end)
+		}
+	}
+}
+
+func TestFirstFailureTrackerTracksLowestIndex(t *testing.T) {
+	tr := &firstFailureTracker{}
+	if got := tr.get(); got != nil {
+		t.Fatalf("expected nil on an empty tracker, got %v", *got)
+	}
+
+	tr.record(42)
+	tr.record(10)
+	tr.record(99)
+
+	got := tr.get()
+	if got == nil || *got != 10 {
+		t.Fatalf("expected the lowest recorded index 10, got %v", got)
+	}
+}
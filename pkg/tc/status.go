@@ -0,0 +1,63 @@
+/*
+Copyright 2019-2020 vChain, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tc
+
+import (
+	"sync"
+	"time"
+)
+
+// Status is a snapshot of the trust checker's last completed scanning cycle. It is what an
+// operator should alert on, rather than tailing logs for ErrConsistencyFail.
+type Status struct {
+	Trusted           bool          `json:"trusted"`
+	LastCheckedIndex  uint64        `json:"last_checked_index"`
+	ItemsVerified     uint64        `json:"items_verified"`
+	ItemsFailed       uint64        `json:"items_failed"`
+	CycleDuration     time.Duration `json:"cycle_duration"`
+	LastRootFetch     time.Time     `json:"last_root_fetch"`
+	FirstFailingIndex *uint64       `json:"first_failing_index,omitempty"`
+	CurrentRoot       []byte        `json:"current_root"`
+	PreviousRoot      []byte        `json:"previous_root,omitempty"`
+}
+
+// TimeSinceLastRootFetch returns how long ago the last successful root fetch completed.
+func (st Status) TimeSinceLastRootFetch() time.Duration {
+	if st.LastRootFetch.IsZero() {
+		return 0
+	}
+	return time.Since(st.LastRootFetch)
+}
+
+// statusBox guards the trust checker's Status behind a mutex, since it is written by the
+// scanning loop and read concurrently from GetStatus and the /status HTTP endpoint.
+type statusBox struct {
+	mu sync.RWMutex
+	st Status
+}
+
+func (b *statusBox) set(st Status) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.st = st
+}
+
+func (b *statusBox) get() Status {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.st
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2019-2020 vChain, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tc
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatusBoxGetReturnsLastSet(t *testing.T) {
+	var box statusBox
+
+	if got := box.get(); got.LastCheckedIndex != 0 {
+		t.Fatalf("expected a zero-value Status before the first set, got %+v", got)
+	}
+
+	box.set(Status{LastCheckedIndex: 42, Trusted: true})
+	got := box.get()
+	if got.LastCheckedIndex != 42 || !got.Trusted {
+		t.Fatalf("expected the last set Status back, got %+v", got)
+	}
+}
+
+func TestStatusBoxConcurrentAccess(t *testing.T) {
+	var box statusBox
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			box.set(Status{LastCheckedIndex: uint64(i)})
+		}(i)
+		go func() {
+			defer wg.Done()
+			_ = box.get()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestStatusTimeSinceLastRootFetch(t *testing.T) {
+	if got := (Status{}).TimeSinceLastRootFetch(); got != 0 {
+		t.Fatalf("expected 0 for a zero-value LastRootFetch, got %s", got)
+	}
+
+	st := Status{LastRootFetch: time.Now().Add(-time.Minute)}
+	if got := st.TimeSinceLastRootFetch(); got < time.Minute {
+		t.Fatalf("expected at least a minute since LastRootFetch, got %s", got)
+	}
+}
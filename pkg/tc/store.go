@@ -0,0 +1,218 @@
+/*
+Copyright 2019-2020 vChain, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	cindexBucket    = []byte("cindex")
+	rootsBucket     = []byte("roots")
+	failureBucket   = []byte("failures")
+	splitViewBucket = []byte("splitviews")
+	cindexKey       = []byte("consistent_index")
+)
+
+// SplitView is evidence that two auditors observed a different root at the same index, i.e. that
+// the server served different histories to different observers.
+type SplitView struct {
+	Peer      string     `json:"peer"`
+	Local     *RootEntry `json:"local"`
+	Remote    *RootEntry `json:"remote"`
+	Timestamp time.Time  `json:"timestamp"`
+}
+
+// RootEntry is a single observation of a server root, as seen and verified by the trust checker.
+// It is the unit of evidence persisted by an AuditStore: if a server later rewrites its history,
+// the sequence of RootEntry values recorded here is what lets an operator prove what was actually
+// observed and when.
+//
+// The client in this tree does not currently return a server signature alongside CurrentRoot, so
+// none is captured here; add a Signature field once client.ImmuClient exposes one instead of
+// persisting a field that is always nil.
+type RootEntry struct {
+	Index     uint64    `json:"index"`
+	Root      []byte    `json:"root"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// AuditStore persists everything the trust checker needs to survive a restart without losing
+// track of what it has already verified: the highest index it has consistently scanned up to,
+// every root it has observed along the way, and any index where verification failed.
+type AuditStore interface {
+	// GetConsistentIndex returns the highest index up to which every index has already been
+	// scanned and either verified or recorded as a failure. It returns 0, false, nil when the
+	// store is empty and scanning should start from the beginning.
+	GetConsistentIndex() (index uint64, ok bool, err error)
+
+	// SetConsistentIndex persists the highest index up to which every index has been scanned
+	// and either verified or recorded as a failure.
+	SetConsistentIndex(index uint64) error
+
+	// AddRoot persists a root observed by the trust checker.
+	AddRoot(entry *RootEntry) error
+
+	// AddFailure records an index at which verification failed.
+	AddFailure(index uint64) error
+
+	// AddSplitView persists evidence that a peer observed a different root than local at the
+	// same index.
+	AddSplitView(sv *SplitView) error
+
+	// GetSplitViews returns every split view recorded at index, one per peer that disagreed
+	// with the local observation there.
+	GetSplitViews(index uint64) ([]*SplitView, error)
+
+	// GetHistory returns every root observed between from and to (inclusive), ordered by index.
+	GetHistory(from, to uint64) ([]*RootEntry, error)
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// boltAuditStore is the default AuditStore implementation, backed by a local BoltDB file.
+type boltAuditStore struct {
+	db *bolt.DB
+}
+
+// NewBoltAuditStore opens (creating if necessary) a BoltDB-backed AuditStore at path.
+func NewBoltAuditStore(path string) (AuditStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit store at %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{cindexBucket, rootsBucket, failureBucket, splitViewBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &boltAuditStore{db: db}, nil
+}
+
+func (s *boltAuditStore) GetConsistentIndex() (index uint64, ok bool, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(cindexBucket).Get(cindexKey)
+		if v == nil {
+			return nil
+		}
+		index = binary.BigEndian.Uint64(v)
+		ok = true
+		return nil
+	})
+	return index, ok, err
+}
+
+func (s *boltAuditStore) SetConsistentIndex(index uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, index)
+		return tx.Bucket(cindexBucket).Put(cindexKey, v)
+	})
+}
+
+func (s *boltAuditStore) AddRoot(entry *RootEntry) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		v, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(rootsBucket).Put(indexKey(entry.Index), v)
+	})
+}
+
+func (s *boltAuditStore) AddFailure(index uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, uint64(time.Now().Unix()))
+		return tx.Bucket(failureBucket).Put(indexKey(index), v)
+	})
+}
+
+func (s *boltAuditStore) AddSplitView(sv *SplitView) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		v, err := json.Marshal(sv)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(splitViewBucket).Put(splitViewKey(sv.Local.Index, sv.Peer), v)
+	})
+}
+
+// splitViewKey keys split-view evidence by index and peer, not index alone, so that two peers
+// disagreeing with us at the same index in the same round don't overwrite each other's evidence.
+func splitViewKey(index uint64, peer string) []byte {
+	return append(indexKey(index), []byte("|"+peer)...)
+}
+
+func (s *boltAuditStore) GetSplitViews(index uint64) ([]*SplitView, error) {
+	var views []*SplitView
+	prefix := indexKey(index)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(splitViewBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var sv SplitView
+			if err := json.Unmarshal(v, &sv); err != nil {
+				return err
+			}
+			views = append(views, &sv)
+		}
+		return nil
+	})
+	return views, err
+}
+
+func (s *boltAuditStore) GetHistory(from, to uint64) ([]*RootEntry, error) {
+	var entries []*RootEntry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(rootsBucket).Cursor()
+		min := indexKey(from)
+		max := indexKey(to)
+		for k, v := c.Seek(min); k != nil && string(k) <= string(max); k, v = c.Next() {
+			var entry RootEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, &entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func (s *boltAuditStore) Close() error {
+	return s.db.Close()
+}
+
+func indexKey(index uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, index)
+	return k
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2019-2020 vChain, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tc
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) AuditStore {
+	t.Helper()
+	store, err := NewBoltAuditStore(filepath.Join(t.TempDir(), "audit.db"))
+	if err != nil {
+		t.Fatalf("NewBoltAuditStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestBoltAuditStoreConsistentIndex(t *testing.T) {
+	store := newTestStore(t)
+
+	if _, ok, err := store.GetConsistentIndex(); err != nil {
+		t.Fatalf("GetConsistentIndex: %v", err)
+	} else if ok {
+		t.Fatalf("expected no consistent index in a fresh store")
+	}
+
+	if err := store.SetConsistentIndex(42); err != nil {
+		t.Fatalf("SetConsistentIndex: %v", err)
+	}
+	index, ok, err := store.GetConsistentIndex()
+	if err != nil {
+		t.Fatalf("GetConsistentIndex: %v", err)
+	}
+	if !ok || index != 42 {
+		t.Fatalf("expected consistent index 42, got %d (ok=%v)", index, ok)
+	}
+}
+
+func TestBoltAuditStoreHistoryRange(t *testing.T) {
+	store := newTestStore(t)
+
+	for i := uint64(0); i < 5; i++ {
+		entry := &RootEntry{Index: i, Root: []byte{byte(i)}, Timestamp: time.Now()}
+		if err := store.AddRoot(entry); err != nil {
+			t.Fatalf("AddRoot(%d): %v", i, err)
+		}
+	}
+
+	history, err := store.GetHistory(1, 3)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("expected 3 entries in [1,3], got %d", len(history))
+	}
+	for i, entry := range history {
+		want := uint64(1 + i)
+		if entry.Index != want {
+			t.Fatalf("entry %d: expected index %d, got %d", i, want, entry.Index)
+		}
+	}
+}
+
+func TestBoltAuditStoreAddFailure(t *testing.T) {
+	store := newTestStore(t)
+
+	if err := store.AddFailure(7); err != nil {
+		t.Fatalf("AddFailure: %v", err)
+	}
+}
+
+func TestBoltAuditStoreResumesAcrossInstances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.db")
+
+	store, err := NewBoltAuditStore(path)
+	if err != nil {
+		t.Fatalf("NewBoltAuditStore: %v", err)
+	}
+	if err := store.SetConsistentIndex(99); err != nil {
+		t.Fatalf("SetConsistentIndex: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened, err := NewBoltAuditStore(path)
+	if err != nil {
+		t.Fatalf("re-opening store: %v", err)
+	}
+	defer reopened.Close()
+
+	index, ok, err := reopened.GetConsistentIndex()
+	if err != nil {
+		t.Fatalf("GetConsistentIndex: %v", err)
+	}
+	if !ok || index != 99 {
+		t.Fatalf("expected the consistent index to survive a restart, got %d (ok=%v)", index, ok)
+	}
+}